@@ -0,0 +1,229 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Duration wraps time.Duration so it can be configured in the yaml file as a
+// Go duration string, e.g. "5s" or "250ms".
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %v", s, err)
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// Config is the root of kaf's on-disk configuration file (~/.kaf/config).
+type Config struct {
+	CurrentCluster string     `yaml:"current-cluster"`
+	Clusters       []*Cluster `yaml:"clusters"`
+}
+
+// Cluster describes how to connect to a single Kafka cluster.
+type Cluster struct {
+	Name             string   `yaml:"name"`
+	Version          string   `yaml:"version"`
+	Brokers          []string `yaml:"brokers"`
+	SecurityProtocol string   `yaml:"securityProtocol"`
+	TLS              *TLS     `yaml:"TLS"`
+	SASL             *SASL    `yaml:"SASL"`
+	// Kerberos configures GSSAPI authentication, used when
+	// SASL.Mechanism is "GSSAPI".
+	Kerberos *Kerberos `yaml:"kerberos"`
+
+	// ConnectTimeout bounds how long dialing a broker may take. Defaults to
+	// sarama's own dial timeout when zero.
+	ConnectTimeout Duration `yaml:"connectTimeout"`
+	// MaxRetries is how many attempts withRetry makes for a transient sarama
+	// error before giving up. Defaults to 3 when zero.
+	MaxRetries int `yaml:"maxRetries"`
+	// RetryBackoff is the base delay between retries; actual delay grows
+	// exponentially with jitter. Defaults to 500ms when zero.
+	RetryBackoff Duration `yaml:"retryBackoff"`
+}
+
+// TLS holds the certificate material used to establish a TLS connection to
+// the brokers. When Cafile is empty, the system CA pool is trusted instead,
+// which covers cloud-managed Kafka using well-known public CAs.
+type TLS struct {
+	Cafile        string `yaml:"cafile"`
+	Clientfile    string `yaml:"clientfile"`
+	Clientkeyfile string `yaml:"clientkeyfile"`
+	Insecure      bool   `yaml:"insecure"`
+
+	// ServerName overrides the hostname sent via SNI and checked against the
+	// broker's certificate, useful when brokers sit behind a load balancer
+	// whose advertised hostname differs from the certificate's SAN.
+	ServerName string `yaml:"serverName"`
+
+	// Certificates configures additional client certificate/key pairs for
+	// mTLS, on top of Clientfile/Clientkeyfile. Each entry is a separate PEM
+	// bundle; crypto/tls presents the first one the broker's certificate
+	// request accepts.
+	Certificates []ClientCertificate `yaml:"certificates"`
+}
+
+// ClientCertificate is one client certificate/key pair used for mTLS.
+type ClientCertificate struct {
+	Certfile string `yaml:"certfile"`
+	Keyfile  string `yaml:"keyfile"`
+}
+
+// SASL holds the credentials and mechanism-specific settings used for SASL
+// authentication, independent of whether the connection is also wrapped in
+// TLS.
+//
+// Mechanism selects which of PLAIN, SCRAM-SHA-256, SCRAM-SHA-512, GSSAPI or
+// OAUTHBEARER is used; it is honored regardless of SecurityProtocol, so e.g.
+// SCRAM over SASL_PLAINTEXT works just as well as over SASL_SSL.
+type SASL struct {
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password"`
+	Mechanism string `yaml:"mechanism"`
+
+	TokenProvider *TokenProvider `yaml:"tokenProvider"`
+}
+
+// Kerberos configures GSSAPI/Kerberos authentication against an enterprise
+// Kafka cluster, used when SASL.Mechanism is "GSSAPI". Either Password or
+// KeytabPath must be set; KerberosConfigPath and, if set, KeytabPath are
+// validated to exist when the config is loaded.
+type Kerberos struct {
+	ServiceName        string `yaml:"serviceName"`
+	Realm              string `yaml:"realm"`
+	KerberosConfigPath string `yaml:"kerberosConfigPath"`
+	Username           string `yaml:"username"`
+	Password           string `yaml:"password"`
+	KeytabPath         string `yaml:"keytabPath"`
+	// DisablePAFXFAST disables the FAST negotiation some KDCs don't support.
+	DisablePAFXFAST bool `yaml:"disablePAFXFAST"`
+}
+
+// TokenProvider configures how an OAUTHBEARER token is obtained when
+// Mechanism is "OAUTHBEARER". Exactly one of Token, Command or OIDC should
+// be set.
+type TokenProvider struct {
+	// Token is a static bearer token, used as-is.
+	Token string `yaml:"token"`
+	// Command is shelled out to on every refresh; its trimmed stdout is used
+	// as the bearer token.
+	Command string `yaml:"command"`
+	// OIDC fetches a token via the OAuth2 client-credentials flow.
+	OIDC *OIDC `yaml:"oidc"`
+
+	// CacheSkewSeconds is how long before a token's expiry it is refreshed.
+	// Defaults to 30s when zero. Ignored for a static Token.
+	CacheSkewSeconds int `yaml:"cacheSkewSeconds"`
+}
+
+// OIDC describes an OAuth2 client-credentials grant used to mint OAUTHBEARER
+// tokens, e.g. for Confluent Cloud or Azure Event Hubs.
+type OIDC struct {
+	IssuerURL    string   `yaml:"issuerUrl"`
+	ClientID     string   `yaml:"clientId"`
+	ClientSecret string   `yaml:"clientSecret"`
+	Scopes       []string `yaml:"scopes"`
+}
+
+func configPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".kaf", "config"), nil
+}
+
+// ReadConfig loads the kaf config file from path, or from the default
+// location (~/.kaf/config) when path is empty.
+func ReadConfig(path string) (*Config, error) {
+	if path == "" {
+		var err error
+		path, err = configPath()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Config{}, nil
+		}
+		return nil, fmt.Errorf("unable to read config: %v", err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse config: %v", err)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// validate checks config that can't be caught by yaml unmarshalling alone,
+// such as files a cluster's auth mechanism depends on actually existing.
+func (c *Config) validate() error {
+	for _, cluster := range c.Clusters {
+		if err := cluster.validate(); err != nil {
+			return fmt.Errorf("cluster %q: %v", cluster.Name, err)
+		}
+	}
+	return nil
+}
+
+func (cl *Cluster) validate() error {
+	if cl.SASL == nil || cl.SASL.Mechanism != "GSSAPI" {
+		return nil
+	}
+
+	k := cl.Kerberos
+	if k == nil {
+		return fmt.Errorf("SASL mechanism is GSSAPI but no kerberos config was provided")
+	}
+	if k.KerberosConfigPath == "" {
+		return fmt.Errorf("kerberos.kerberosConfigPath is required")
+	}
+	if _, err := os.Stat(k.KerberosConfigPath); err != nil {
+		return fmt.Errorf("kerberos.kerberosConfigPath: %v", err)
+	}
+	if k.KeytabPath == "" && k.Password == "" {
+		return fmt.Errorf("kerberos config must set either keytabPath or password")
+	}
+	if k.KeytabPath != "" {
+		if _, err := os.Stat(k.KeytabPath); err != nil {
+			return fmt.Errorf("kerberos.keytabPath: %v", err)
+		}
+	}
+	return nil
+}
+
+// ActiveCluster returns the cluster selected via CurrentCluster, or nil if
+// none is configured.
+func (c *Config) ActiveCluster() *Cluster {
+	for _, cluster := range c.Clusters {
+		if cluster.Name == c.CurrentCluster {
+			return cluster
+		}
+	}
+	return nil
+}
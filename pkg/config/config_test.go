@@ -0,0 +1,92 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTempFile(t *testing.T, dir, name string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte("test"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return path
+}
+
+func TestClusterValidate_GSSAPIRequiresKerberosConfig(t *testing.T) {
+	cl := &Cluster{Name: "prod", SASL: &SASL{Mechanism: "GSSAPI"}}
+
+	if err := cl.validate(); err == nil {
+		t.Fatalf("expected error when kerberos config is missing")
+	}
+}
+
+func TestClusterValidate_GSSAPIRequiresExistingKerberosConfigPath(t *testing.T) {
+	cl := &Cluster{
+		Name: "prod",
+		SASL: &SASL{Mechanism: "GSSAPI"},
+		Kerberos: &Kerberos{
+			KerberosConfigPath: "/does/not/exist/krb5.conf",
+			Password:           "pass",
+		},
+	}
+
+	if err := cl.validate(); err == nil {
+		t.Fatalf("expected error for missing krb5.conf")
+	}
+}
+
+func TestClusterValidate_GSSAPIRequiresPasswordOrKeytab(t *testing.T) {
+	dir := t.TempDir()
+	krb5 := writeTempFile(t, dir, "krb5.conf")
+
+	cl := &Cluster{
+		Name:     "prod",
+		SASL:     &SASL{Mechanism: "GSSAPI"},
+		Kerberos: &Kerberos{KerberosConfigPath: krb5},
+	}
+
+	if err := cl.validate(); err == nil {
+		t.Fatalf("expected error when neither password nor keytab is set")
+	}
+}
+
+func TestClusterValidate_GSSAPIWithKeytabSucceeds(t *testing.T) {
+	dir := t.TempDir()
+	krb5 := writeTempFile(t, dir, "krb5.conf")
+	keytab := writeTempFile(t, dir, "kaf.keytab")
+
+	cl := &Cluster{
+		Name: "prod",
+		SASL: &SASL{Mechanism: "GSSAPI"},
+		Kerberos: &Kerberos{
+			KerberosConfigPath: krb5,
+			KeytabPath:         keytab,
+		},
+	}
+
+	if err := cl.validate(); err != nil {
+		t.Fatalf("validate() error = %v", err)
+	}
+}
+
+func TestClusterValidate_NonGSSAPIIgnoresKerberos(t *testing.T) {
+	cl := &Cluster{Name: "prod", SASL: &SASL{Mechanism: "PLAIN"}}
+
+	if err := cl.validate(); err != nil {
+		t.Fatalf("validate() error = %v", err)
+	}
+}
+
+func TestReadConfig_MissingFileReturnsEmptyConfig(t *testing.T) {
+	cfg, err := ReadConfig(filepath.Join(os.TempDir(), "kaf-config-that-does-not-exist.yaml"))
+	if err != nil {
+		t.Fatalf("ReadConfig() error = %v", err)
+	}
+	if len(cfg.Clusters) != 0 {
+		t.Fatalf("expected no clusters, got %d", len(cfg.Clusters))
+	}
+}
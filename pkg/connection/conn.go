@@ -1,18 +1,23 @@
 package connection
 
 import (
-	"crypto/tls"
-	"crypto/x509"
 	"fmt"
-	"io/ioutil"
+	"sync"
 	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/birdayz/kaf/pkg/config"
+	"golang.org/x/sync/singleflight"
 )
 
+// ConnManager caches one sarama.Client per cluster name. It is safe for
+// concurrent use: conns is guarded by mu, and group collapses concurrent
+// GetClient calls for the same cluster into a single dial.
 type ConnManager struct {
+	mu    sync.RWMutex
 	conns map[string]sarama.Client
+
+	group singleflight.Group
 }
 
 func NewConnManager() *ConnManager {
@@ -21,6 +26,48 @@ func NewConnManager() *ConnManager {
 	}
 }
 
+func (c *ConnManager) getConn(cluster string) (sarama.Client, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	cl, ok := c.conns[cluster]
+	return cl, ok
+}
+
+func (c *ConnManager) setConn(cluster string, client sarama.Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conns[cluster] = client
+}
+
+// Close closes every cached client and drops them from the cache.
+func (c *ConnManager) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var firstErr error
+	for name, cl := range c.conns {
+		if err := cl.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(c.conns, name)
+	}
+	return firstErr
+}
+
+// CloseCluster closes the cached client for cluster, if any, and drops it
+// from the cache.
+func (c *ConnManager) CloseCluster(cluster string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cl, ok := c.conns[cluster]
+	if !ok {
+		return nil
+	}
+	delete(c.conns, cluster)
+	return cl.Close()
+}
+
 func (c *ConnManager) Connect(cluster string) error {
 	_, err := c.GetAdminClient(cluster)
 	if err != nil {
@@ -29,119 +76,141 @@ func (c *ConnManager) Connect(cluster string) error {
 	return nil
 }
 
-func (c *ConnManager) GetClient(cluster string) (sarama.Client, error) {
-	if cl, ok := c.conns[cluster]; ok {
-		return cl, nil
-	}
+// resolveCluster looks up a cluster by name, falling back to the active
+// cluster when name is empty.
+func resolveCluster(name string) (*config.Cluster, error) {
 	configTotal, err := config.ReadConfig("")
 	if err != nil {
 		return nil, err
 	}
 
 	var cl *config.Cluster
-	for _, cx := range configTotal.Clusters {
-		if cx.Name == cluster {
-			cl = cx
+	if name == "" {
+		cl = configTotal.ActiveCluster()
+	} else {
+		for _, cx := range configTotal.Clusters {
+			if cx.Name == name {
+				cl = cx
+			}
 		}
 	}
 	if cl == nil {
-		return nil, fmt.Errorf("Cluster \"%v\" not found.", cluster)
-	}
-
-	cfg, err := toSaramaConfig(cl)
-	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("Cluster \"%v\" not found.", name)
 	}
+	return cl, nil
+}
 
-	client, err := sarama.NewClient(cl.Brokers, cfg)
-	if err != nil {
-		return nil, err
+func (c *ConnManager) GetClient(cluster string) (sarama.Client, error) {
+	if cl, ok := c.getConn(cluster); ok {
+		return cl, nil
 	}
 
-	c.conns[cluster] = client
-
-	return client, nil
-
-}
+	v, err, _ := c.group.Do(cluster, func() (interface{}, error) {
+		if cl, ok := c.getConn(cluster); ok {
+			return cl, nil
+		}
 
-func (c *ConnManager) GetAvailableOffsets(broker *sarama.Broker, cluster string, req *sarama.OffsetRequest) (*sarama.OffsetResponse, error) {
-	resp, err := broker.GetAvailableOffsets(req)
-	if err != nil {
-		broker.Close()
-		cfg, err := c.GetConfig(cluster)
+		cl, err := resolveCluster(cluster)
 		if err != nil {
 			return nil, err
 		}
-		broker.Open(cfg)
-		return broker.GetAvailableOffsets(req)
 
-	}
-	return resp, nil
-}
+		var client sarama.Client
+		err = withRetry(cl, func() error {
+			cfg, err := toSaramaConfig(cl)
+			if err != nil {
+				return err
+			}
+			client, err = sarama.NewClient(cl.Brokers, cfg)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
 
-func (c *ConnManager) GetConfig(cluster string) (*sarama.Config, error) {
-	configTotal, err := config.ReadConfig("")
+		c.setConn(cluster, client)
+		return client, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	var cl *config.Cluster
-	if cluster == "" {
-		cl = configTotal.ActiveCluster()
-	} else {
-		for _, cx := range configTotal.Clusters {
-			if cx.Name == cluster {
-				cl = cx
-			}
-		}
-	}
-	if cl == nil {
-		cl = configTotal.ActiveCluster()
+	return v.(sarama.Client), nil
+}
+
+// Ping issues a lightweight metadata request to verify that cluster is
+// reachable, retrying on transient errors per its MaxRetries/RetryBackoff
+// config. The request itself is bounded by ConnectTimeout, which
+// toSaramaConfig also applies to sarama's Metadata.Timeout.
+func (c *ConnManager) Ping(cluster string) error {
+	client, err := c.GetClient(cluster)
+	if err != nil {
+		return err
 	}
 
-	cfg, err := toSaramaConfig(cl)
+	cl, err := resolveCluster(cluster)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return cfg, nil
 
+	return withRetry(cl, func() error {
+		return client.RefreshMetadata()
+	})
 }
 
-func (c *ConnManager) GetAdminClient(cluster string) (sarama.ClusterAdmin, error) {
-	if cl, ok := c.conns[cluster]; ok {
-		return sarama.NewClusterAdminFromClient(cl)
+// Reconnect closes and rebuilds the sarama client backing cluster, e.g.
+// after a broker failover that the existing client's metadata hasn't caught
+// up with yet.
+func (c *ConnManager) Reconnect(cluster string) error {
+	if err := c.CloseCluster(cluster); err != nil {
+		return err
 	}
-	configTotal, err := config.ReadConfig("")
+
+	_, err := c.GetClient(cluster)
+	return err
+}
+
+func (c *ConnManager) GetAvailableOffsets(broker *sarama.Broker, cluster string, req *sarama.OffsetRequest) (*sarama.OffsetResponse, error) {
+	cl, err := resolveCluster(cluster)
 	if err != nil {
 		return nil, err
 	}
 
-	var cl *config.Cluster
-	if cluster == "" {
-		cl = configTotal.ActiveCluster()
-	} else {
-		for _, cx := range configTotal.Clusters {
-			if cx.Name == cluster {
-				cl = cx
+	var resp *sarama.OffsetResponse
+	err = withRetry(cl, func() error {
+		var err error
+		resp, err = broker.GetAvailableOffsets(req)
+		if err != nil {
+			broker.Close()
+			cfg, cfgErr := c.GetConfig(cluster)
+			if cfgErr != nil {
+				return cfgErr
 			}
+			if openErr := broker.Open(cfg); openErr != nil {
+				return openErr
+			}
+			resp, err = broker.GetAvailableOffsets(req)
 		}
-	}
-	if cl == nil {
-		cl = configTotal.ActiveCluster()
-	}
+		return err
+	})
+	return resp, err
+}
 
-	cfg, err := toSaramaConfig(cl)
+func (c *ConnManager) GetConfig(cluster string) (*sarama.Config, error) {
+	cl, err := resolveCluster(cluster)
 	if err != nil {
 		return nil, err
 	}
 
-	client, err := sarama.NewClient(cl.Brokers, cfg)
+	return toSaramaConfig(cl)
+}
+
+func (c *ConnManager) GetAdminClient(cluster string) (sarama.ClusterAdmin, error) {
+	client, err := c.GetClient(cluster)
 	if err != nil {
 		return nil, err
 	}
 
-	c.conns[cluster] = client
-
 	return sarama.NewClusterAdminFromClient(client)
 }
 
@@ -159,74 +228,48 @@ func toSaramaConfig(cluster *config.Cluster) (saramaConfig *sarama.Config, err e
 		}
 		saramaConfig.Version = parsedVersion
 	}
+	if cluster.ConnectTimeout.Duration > 0 {
+		saramaConfig.Net.DialTimeout = cluster.ConnectTimeout.Duration
+		saramaConfig.Metadata.Timeout = cluster.ConnectTimeout.Duration
+	}
 	if cluster.SASL != nil {
 		saramaConfig.Net.SASL.Enable = true
+		saramaConfig.Net.SASL.Handshake = true
 		saramaConfig.Net.SASL.User = cluster.SASL.Username
 		saramaConfig.Net.SASL.Password = cluster.SASL.Password
-	}
-	if cluster.TLS != nil && cluster.SecurityProtocol != "SASL_SSL" {
-		saramaConfig.Net.TLS.Enable = true
-		tlsConfig := &tls.Config{
-			InsecureSkipVerify: cluster.TLS.Insecure,
-		}
 
-		if cluster.TLS.Cafile != "" {
-			caCert, err := ioutil.ReadFile(cluster.TLS.Cafile)
-			if err != nil {
-				return nil, fmt.Errorf("Unable to read Cafile :%v", err)
-			}
-			caCertPool := x509.NewCertPool()
-			caCertPool.AppendCertsFromPEM(caCert)
-			tlsConfig.RootCAs = caCertPool
-		}
-
-		if cluster.TLS.Clientfile != "" && cluster.TLS.Clientkeyfile != "" {
-			clientCert, err := ioutil.ReadFile(cluster.TLS.Clientfile)
-			if err != nil {
-				return nil, fmt.Errorf("Unable to read Clientfile :%v", err)
-			}
-			clientKey, err := ioutil.ReadFile(cluster.TLS.Clientkeyfile)
-			if err != nil {
-				return nil, fmt.Errorf("Unable to read Clientkeyfile :%v", err)
+		switch cluster.SASL.Mechanism {
+		case "", "PLAIN":
+			saramaConfig.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		case "SCRAM-SHA-256":
+			saramaConfig.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+			saramaConfig.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &XDGSCRAMClient{HashGeneratorFcn: SHA256} }
+		case "SCRAM-SHA-512":
+			saramaConfig.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+			saramaConfig.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &XDGSCRAMClient{HashGeneratorFcn: SHA512} }
+		case "GSSAPI":
+			saramaConfig.Net.SASL.Mechanism = sarama.SASLTypeGSSAPI
+			if err := configureGSSAPI(cluster.Kerberos, saramaConfig); err != nil {
+				return nil, err
 			}
-
-			cert, err := tls.X509KeyPair([]byte(clientCert), []byte(clientKey))
+		case "OAUTHBEARER":
+			saramaConfig.Net.SASL.Mechanism = sarama.SASLTypeOAuth
+			tokenProvider, err := newTokenProvider(cluster.SASL.TokenProvider)
 			if err != nil {
-				return nil, fmt.Errorf("Unable to creatre KeyPair: %v", err)
+				return nil, err
 			}
-			tlsConfig.Certificates = []tls.Certificate{cert}
-
-			tlsConfig.BuildNameToCertificate()
+			saramaConfig.Net.SASL.TokenProvider = tokenProvider
+		default:
+			return nil, fmt.Errorf("unsupported SASL mechanism: %v", cluster.SASL.Mechanism)
 		}
-		saramaConfig.Net.TLS.Config = tlsConfig
 	}
-	if cluster.SecurityProtocol == "SASL_SSL" {
+	if cluster.TLS != nil || cluster.SecurityProtocol == "SASL_SSL" {
 		saramaConfig.Net.TLS.Enable = true
-		if cluster.TLS != nil {
-			tlsConfig := &tls.Config{
-				InsecureSkipVerify: cluster.TLS.Insecure,
-			}
-			if cluster.TLS.Cafile != "" {
-				caCert, err := ioutil.ReadFile(cluster.TLS.Cafile)
-				if err != nil {
-					return nil, err
-				}
-				caCertPool := x509.NewCertPool()
-				caCertPool.AppendCertsFromPEM(caCert)
-				tlsConfig.RootCAs = caCertPool
-			}
-			saramaConfig.Net.TLS.Config = tlsConfig
-
-		} else {
-			saramaConfig.Net.TLS.Config = &tls.Config{InsecureSkipVerify: false}
-		}
-		if cluster.SASL.Mechanism == "SCRAM-SHA-512" {
-			saramaConfig.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &XDGSCRAMClient{HashGeneratorFcn: SHA512} }
-			saramaConfig.Net.SASL.Mechanism = sarama.SASLMechanism(sarama.SASLTypeSCRAMSHA512)
-		} else if cluster.SASL.Mechanism == "SCRAM-SHA-256" {
-			saramaConfig.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &XDGSCRAMClient{HashGeneratorFcn: SHA256} }
-			saramaConfig.Net.SASL.Mechanism = sarama.SASLMechanism(sarama.SASLTypeSCRAMSHA256)
+		tlsConfig, err := buildTLSConfig(cluster.TLS)
+		if err != nil {
+			return nil, err
 		}
+		saramaConfig.Net.TLS.Config = tlsConfig
 	}
 	return saramaConfig, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,134 @@
+package connection
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/birdayz/kaf/pkg/config"
+)
+
+func TestToSaramaConfig_ConnectTimeoutBoundsMetadataRequests(t *testing.T) {
+	cluster := &config.Cluster{
+		Name:           "test",
+		Brokers:        []string{"localhost:9092"},
+		ConnectTimeout: config.Duration{Duration: 5 * time.Second},
+	}
+
+	saramaConfig, err := toSaramaConfig(cluster)
+	if err != nil {
+		t.Fatalf("toSaramaConfig() error = %v", err)
+	}
+
+	if saramaConfig.Net.DialTimeout != 5*time.Second {
+		t.Fatalf("Net.DialTimeout = %v, want 5s", saramaConfig.Net.DialTimeout)
+	}
+	if saramaConfig.Metadata.Timeout != 5*time.Second {
+		t.Fatalf("Metadata.Timeout = %v, want 5s", saramaConfig.Metadata.Timeout)
+	}
+}
+
+func TestToSaramaConfig_SASLMechanisms(t *testing.T) {
+	dir := t.TempDir()
+	certPEM, keyPEM := generateSelfSignedCertPEM(t)
+	clientfile := writeFile(t, dir, "client-cert.pem", certPEM)
+	clientkeyfile := writeFile(t, dir, "client-key.pem", keyPEM)
+
+	tlsBlocks := map[string]*config.TLS{
+		"plaintext": nil,
+		"tls":       {},
+		"mtls":      {Clientfile: clientfile, Clientkeyfile: clientkeyfile},
+	}
+
+	cases := []struct {
+		name     string
+		sasl     *config.SASL
+		kerberos *config.Kerberos
+		wantMech sarama.SASLMechanism
+		wantErr  bool
+	}{
+		{
+			name:     "plain",
+			sasl:     &config.SASL{Mechanism: "PLAIN", Username: "user", Password: "pass"},
+			wantMech: sarama.SASLTypePlaintext,
+		},
+		{
+			name:     "scram-sha-256",
+			sasl:     &config.SASL{Mechanism: "SCRAM-SHA-256", Username: "user", Password: "pass"},
+			wantMech: sarama.SASLTypeSCRAMSHA256,
+		},
+		{
+			name:     "scram-sha-512",
+			sasl:     &config.SASL{Mechanism: "SCRAM-SHA-512", Username: "user", Password: "pass"},
+			wantMech: sarama.SASLTypeSCRAMSHA512,
+		},
+		{
+			name: "gssapi",
+			sasl: &config.SASL{Mechanism: "GSSAPI"},
+			kerberos: &config.Kerberos{
+				ServiceName: "kafka",
+				Realm:       "EXAMPLE.COM",
+				Username:    "user",
+				Password:    "pass",
+			},
+			wantMech: sarama.SASLTypeGSSAPI,
+		},
+		{
+			name:     "oauthbearer",
+			sasl:     &config.SASL{Mechanism: "OAUTHBEARER", TokenProvider: &config.TokenProvider{Token: "t0ken"}},
+			wantMech: sarama.SASLTypeOAuth,
+		},
+		{
+			name:    "unsupported mechanism",
+			sasl:    &config.SASL{Mechanism: "NOPE"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		for tlsName, tlsBlock := range tlsBlocks {
+			t.Run(tc.name+"/"+tlsName, func(t *testing.T) {
+				cluster := &config.Cluster{
+					Name:     "test",
+					Brokers:  []string{"localhost:9092"},
+					SASL:     tc.sasl,
+					Kerberos: tc.kerberos,
+					TLS:      tlsBlock,
+				}
+				if tlsName != "plaintext" {
+					cluster.SecurityProtocol = "SASL_SSL"
+				}
+
+				saramaConfig, err := toSaramaConfig(cluster)
+				if tc.wantErr {
+					if err == nil {
+						t.Fatalf("expected error, got none")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("toSaramaConfig() error = %v", err)
+				}
+
+				if !saramaConfig.Net.SASL.Enable {
+					t.Fatalf("expected SASL to be enabled")
+				}
+				if !saramaConfig.Net.SASL.Handshake {
+					t.Fatalf("expected SASL handshake to be enabled")
+				}
+				if saramaConfig.Net.SASL.Mechanism != tc.wantMech {
+					t.Fatalf("Mechanism = %v, want %v", saramaConfig.Net.SASL.Mechanism, tc.wantMech)
+				}
+				if tlsName != "plaintext" && !saramaConfig.Net.TLS.Enable {
+					t.Fatalf("expected TLS to be enabled")
+				}
+				if tlsName == "mtls" && len(saramaConfig.Net.TLS.Config.Certificates) != 1 {
+					t.Fatalf("len(Certificates) = %d, want 1 for mTLS", len(saramaConfig.Net.TLS.Config.Certificates))
+				}
+				if tlsName != "mtls" && saramaConfig.Net.TLS.Config != nil && len(saramaConfig.Net.TLS.Config.Certificates) != 0 {
+					t.Fatalf("expected no client certificate outside mTLS, got %d", len(saramaConfig.Net.TLS.Config.Certificates))
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package connection
+
+import (
+	"fmt"
+
+	"github.com/Shopify/sarama"
+	"github.com/birdayz/kaf/pkg/config"
+)
+
+// configureGSSAPI translates a config.Kerberos block into sarama's GSSAPI
+// settings, choosing keytab- or password-based auth depending on which is
+// set.
+func configureGSSAPI(kerberos *config.Kerberos, saramaConfig *sarama.Config) error {
+	if kerberos == nil {
+		return fmt.Errorf("SASL mechanism is GSSAPI but no kerberos config was provided")
+	}
+
+	saramaConfig.Net.SASL.GSSAPI = sarama.GSSAPIConfig{
+		ServiceName:        kerberos.ServiceName,
+		Realm:              kerberos.Realm,
+		Username:           kerberos.Username,
+		KerberosConfigPath: kerberos.KerberosConfigPath,
+		DisablePAFXFAST:    kerberos.DisablePAFXFAST,
+	}
+
+	switch {
+	case kerberos.KeytabPath != "":
+		saramaConfig.Net.SASL.GSSAPI.AuthType = sarama.KRB5_KEYTAB_AUTH
+		saramaConfig.Net.SASL.GSSAPI.KeyTabPath = kerberos.KeytabPath
+	case kerberos.Password != "":
+		saramaConfig.Net.SASL.GSSAPI.AuthType = sarama.KRB5_USER_AUTH
+		saramaConfig.Net.SASL.GSSAPI.Password = kerberos.Password
+	default:
+		return fmt.Errorf("kerberos config must set either keytabPath or password")
+	}
+
+	return nil
+}
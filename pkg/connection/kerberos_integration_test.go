@@ -0,0 +1,55 @@
+//go:build integration
+// +build integration
+
+package connection
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/birdayz/kaf/pkg/config"
+)
+
+// TestGSSAPI_DockerizedKDC exercises a real SASL_GSSAPI handshake against a
+// Kafka broker backed by a dockerized MIT KDC. It is gated behind the
+// "integration" build tag and the KAF_GSSAPI_TEST_BROKER/KAF_GSSAPI_TEST_KRB5/
+// KAF_GSSAPI_TEST_KEYTAB env vars produced by hack/gssapi-integration (see
+// that directory's docker-compose.yml and env.sh), and is skipped otherwise.
+func TestGSSAPI_DockerizedKDC(t *testing.T) {
+	broker := os.Getenv("KAF_GSSAPI_TEST_BROKER")
+	krb5Conf := os.Getenv("KAF_GSSAPI_TEST_KRB5")
+	keytab := os.Getenv("KAF_GSSAPI_TEST_KEYTAB")
+	if broker == "" || krb5Conf == "" || keytab == "" {
+		t.Skip("KAF_GSSAPI_TEST_BROKER/KRB5/KEYTAB not set; skipping dockerized KDC integration test")
+	}
+
+	cluster := &config.Cluster{
+		Name:             "gssapi-integration",
+		Brokers:          []string{broker},
+		SecurityProtocol: "SASL_PLAINTEXT",
+		SASL:             &config.SASL{Mechanism: "GSSAPI"},
+		Kerberos: &config.Kerberos{
+			ServiceName:        "kafka",
+			Realm:              "TEST.KAF",
+			KerberosConfigPath: krb5Conf,
+			KeytabPath:         keytab,
+			Username:           "client",
+		},
+	}
+
+	saramaConfig, err := toSaramaConfig(cluster)
+	if err != nil {
+		t.Fatalf("toSaramaConfig() error = %v", err)
+	}
+
+	client, err := sarama.NewClient(cluster.Brokers, saramaConfig)
+	if err != nil {
+		t.Fatalf("sarama.NewClient() error = %v", err)
+	}
+	defer client.Close()
+
+	if err := client.RefreshMetadata(); err != nil {
+		t.Fatalf("RefreshMetadata() error = %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package connection
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+// fakeClient satisfies sarama.Client via an embedded nil interface, so only
+// the methods these tests actually exercise (Close) need implementing.
+type fakeClient struct {
+	sarama.Client
+	closed bool
+}
+
+func (f *fakeClient) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestConnManager_CloseClearsCache(t *testing.T) {
+	c := NewConnManager()
+	c.setConn("foo", &fakeClient{})
+	c.setConn("bar", &fakeClient{})
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if _, ok := c.getConn("foo"); ok {
+		t.Fatalf("expected foo to be evicted after Close")
+	}
+	if _, ok := c.getConn("bar"); ok {
+		t.Fatalf("expected bar to be evicted after Close")
+	}
+}
+
+func TestConnManager_CloseClusterOnlyAffectsThatCluster(t *testing.T) {
+	c := NewConnManager()
+	c.setConn("foo", &fakeClient{})
+	c.setConn("bar", &fakeClient{})
+
+	if err := c.CloseCluster("foo"); err != nil {
+		t.Fatalf("CloseCluster() error = %v", err)
+	}
+
+	if _, ok := c.getConn("foo"); ok {
+		t.Fatalf("expected foo to be evicted")
+	}
+	if _, ok := c.getConn("bar"); !ok {
+		t.Fatalf("expected bar to remain cached")
+	}
+}
+
+// TestConnManager_SingleflightDedupesConcurrentDials exercises the same
+// singleflight.Group used by GetClient, verifying concurrent callers for the
+// same cluster collapse into a single dial instead of racing to create N
+// clients.
+func TestConnManager_SingleflightDedupesConcurrentDials(t *testing.T) {
+	c := NewConnManager()
+
+	const callers = 50
+
+	var dials int32
+	var arrived int32
+	start := make(chan struct{})
+	unblock := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			atomic.AddInt32(&arrived, 1)
+			c.group.Do("foo", func() (interface{}, error) {
+				// Same double-check as GetClient: a caller that reaches Do
+				// only after the first dial finished finds the cached client.
+				if cl, ok := c.getConn("foo"); ok {
+					return cl, nil
+				}
+				atomic.AddInt32(&dials, 1)
+				<-unblock
+				client := &fakeClient{}
+				c.setConn("foo", client)
+				return client, nil
+			})
+		}()
+	}
+
+	close(start)
+	// Wait for every caller to be about to call Do before letting the
+	// in-flight dial complete, instead of a fixed sleep.
+	for atomic.LoadInt32(&arrived) < callers {
+		runtime.Gosched()
+	}
+	close(unblock)
+	wg.Wait()
+
+	if dials != 1 {
+		t.Fatalf("dials = %d, want 1", dials)
+	}
+}
@@ -0,0 +1,104 @@
+package connection
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/birdayz/kaf/pkg/config"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const defaultTokenCacheSkew = 30 * time.Second
+
+// cachingTokenProvider implements sarama.AccessTokenProvider. It caches the
+// last token it fetched and only calls out to the configured source again
+// once the cache is within skew of expiry, so kaf doesn't hit an external
+// command or IdP on every request that needs a token.
+type cachingTokenProvider struct {
+	cfg    *config.TokenProvider
+	skew   time.Duration
+	source func() (token string, expiresAt time.Time, err error)
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func newTokenProvider(cfg *config.TokenProvider) (sarama.AccessTokenProvider, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("SASL mechanism is OAUTHBEARER but no tokenProvider config was provided")
+	}
+
+	skew := defaultTokenCacheSkew
+	if cfg.CacheSkewSeconds > 0 {
+		skew = time.Duration(cfg.CacheSkewSeconds) * time.Second
+	}
+
+	p := &cachingTokenProvider{cfg: cfg, skew: skew}
+	switch {
+	case cfg.OIDC != nil:
+		p.source = p.fetchOIDCToken
+	case cfg.Command != "":
+		p.source = p.fetchCommandToken
+	case cfg.Token != "":
+		p.source = p.fetchStaticToken
+	default:
+		return nil, fmt.Errorf("tokenProvider config must set one of token, command or oidc")
+	}
+
+	return p, nil
+}
+
+func (p *cachingTokenProvider) Token() (*sarama.AccessToken, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token == "" || time.Now().Add(p.skew).After(p.expiresAt) {
+		token, expiresAt, err := p.source()
+		if err != nil {
+			return nil, err
+		}
+		p.token, p.expiresAt = token, expiresAt
+	}
+
+	return &sarama.AccessToken{Token: p.token}, nil
+}
+
+func (p *cachingTokenProvider) fetchStaticToken() (string, time.Time, error) {
+	return p.cfg.Token, time.Now().Add(100 * 365 * 24 * time.Hour), nil
+}
+
+func (p *cachingTokenProvider) fetchCommandToken() (string, time.Time, error) {
+	out, err := exec.Command("sh", "-c", p.cfg.Command).Output()
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("unable to run tokenCommand: %v", err)
+	}
+	// Commands don't report an expiry. Token() re-fetches once the cache is
+	// within p.skew of the reported expiry, so report one extra skew out
+	// front to get a full skew's worth of caching before that kicks in.
+	return strings.TrimSpace(string(out)), time.Now().Add(2 * p.skew), nil
+}
+
+func (p *cachingTokenProvider) fetchOIDCToken() (string, time.Time, error) {
+	oidc := p.cfg.OIDC
+	cc := clientcredentials.Config{
+		ClientID:     oidc.ClientID,
+		ClientSecret: oidc.ClientSecret,
+		// IssuerURL is used directly as the token endpoint; kaf does not
+		// perform OIDC discovery.
+		TokenURL: oidc.IssuerURL,
+		Scopes:   oidc.Scopes,
+	}
+
+	token, err := cc.Token(context.Background())
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("unable to fetch OIDC token: %v", err)
+	}
+
+	return token.AccessToken, token.Expiry, nil
+}
@@ -0,0 +1,122 @@
+package connection
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/birdayz/kaf/pkg/config"
+)
+
+func TestCachingTokenProvider_Static(t *testing.T) {
+	provider, err := newTokenProvider(&config.TokenProvider{Token: "static-token"})
+	if err != nil {
+		t.Fatalf("newTokenProvider() error = %v", err)
+	}
+
+	token, err := provider.Token()
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if token.Token != "static-token" {
+		t.Fatalf("Token = %q, want %q", token.Token, "static-token")
+	}
+}
+
+func TestCachingTokenProvider_Command(t *testing.T) {
+	provider, err := newTokenProvider(&config.TokenProvider{Command: "echo command-token"})
+	if err != nil {
+		t.Fatalf("newTokenProvider() error = %v", err)
+	}
+
+	token, err := provider.Token()
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if token.Token != "command-token" {
+		t.Fatalf("Token = %q, want %q", token.Token, "command-token")
+	}
+}
+
+func TestCachingTokenProvider_CommandCachesAcrossCalls(t *testing.T) {
+	dir := t.TempDir()
+	callsFile := filepath.Join(dir, "calls")
+
+	provider, err := newTokenProvider(&config.TokenProvider{
+		Command:          fmt.Sprintf("printf x >> %s && echo command-token", callsFile),
+		CacheSkewSeconds: 60,
+	})
+	if err != nil {
+		t.Fatalf("newTokenProvider() error = %v", err)
+	}
+
+	if _, err := provider.Token(); err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if _, err := provider.Token(); err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+
+	calls, err := ioutil.ReadFile(callsFile)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if len(calls) != 1 {
+		t.Fatalf("tokenCommand ran %d times, want 1 (cached)", len(calls))
+	}
+}
+
+func TestCachingTokenProvider_CachesUntilSkew(t *testing.T) {
+	calls := 0
+	p := &cachingTokenProvider{
+		cfg:  &config.TokenProvider{},
+		skew: time.Minute,
+		source: func() (string, time.Time, error) {
+			calls++
+			return "token", time.Now().Add(time.Hour), nil
+		},
+	}
+
+	if _, err := p.Token(); err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if _, err := p.Token(); err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+
+	if calls != 1 {
+		t.Fatalf("source called %d times, want 1 (cached)", calls)
+	}
+}
+
+func TestCachingTokenProvider_OIDC(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"oidc-token","token_type":"bearer","expires_in":3600}`))
+	}))
+	defer srv.Close()
+
+	provider, err := newTokenProvider(&config.TokenProvider{
+		OIDC: &config.OIDC{
+			IssuerURL:    srv.URL,
+			ClientID:     "client",
+			ClientSecret: "secret",
+			Scopes:       []string{"kafka"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("newTokenProvider() error = %v", err)
+	}
+
+	token, err := provider.Token()
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if token.Token != "oidc-token" {
+		t.Fatalf("Token = %q, want %q", token.Token, "oidc-token")
+	}
+}
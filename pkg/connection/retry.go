@@ -0,0 +1,53 @@
+package connection
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/birdayz/kaf/pkg/config"
+)
+
+const (
+	defaultMaxRetries   = 3
+	defaultRetryBackoff = 500 * time.Millisecond
+)
+
+// withRetry runs fn, retrying with exponential backoff and jitter while it
+// returns a transient sarama error such as ErrOutOfBrokers. Retry count and
+// backoff come from the cluster config, falling back to sane defaults.
+func withRetry(cluster *config.Cluster, fn func() error) error {
+	maxRetries := cluster.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultMaxRetries
+	}
+	backoff := cluster.RetryBackoff.Duration
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+
+	var err error
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		if err = fn(); err == nil || !isRetryable(err) {
+			return err
+		}
+		if attempt == maxRetries-1 {
+			break
+		}
+		time.Sleep(backoffWithJitter(backoff, attempt))
+	}
+	return err
+}
+
+func isRetryable(err error) bool {
+	return errors.Is(err, sarama.ErrOutOfBrokers) ||
+		errors.Is(err, sarama.ErrNotEnoughReplicas) ||
+		errors.Is(err, sarama.ErrLeaderNotAvailable) ||
+		errors.Is(err, sarama.ErrNotLeaderForPartition)
+}
+
+func backoffWithJitter(base time.Duration, attempt int) time.Duration {
+	exp := base * time.Duration(uint64(1)<<uint(attempt))
+	return exp/2 + time.Duration(rand.Int63n(int64(exp)/2+1))
+}
@@ -0,0 +1,70 @@
+package connection
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/birdayz/kaf/pkg/config"
+)
+
+func TestWithRetry_StopsOnNonRetryableError(t *testing.T) {
+	calls := 0
+	wantErr := errors.New("boom")
+
+	err := withRetry(&config.Cluster{}, func() error {
+		calls++
+		return wantErr
+	})
+
+	if err != wantErr {
+		t.Fatalf("err = %v, want %v", err, wantErr)
+	}
+	if calls != 1 {
+		t.Fatalf("calls = %d, want 1", calls)
+	}
+}
+
+func TestWithRetry_RetriesTransientErrorUpToMaxRetries(t *testing.T) {
+	calls := 0
+	cluster := &config.Cluster{
+		MaxRetries:   3,
+		RetryBackoff: config.Duration{Duration: time.Millisecond},
+	}
+
+	err := withRetry(cluster, func() error {
+		calls++
+		return sarama.ErrOutOfBrokers
+	})
+
+	if err != sarama.ErrOutOfBrokers {
+		t.Fatalf("err = %v, want %v", err, sarama.ErrOutOfBrokers)
+	}
+	if calls != 3 {
+		t.Fatalf("calls = %d, want 3", calls)
+	}
+}
+
+func TestWithRetry_SucceedsAfterTransientErrors(t *testing.T) {
+	calls := 0
+	cluster := &config.Cluster{
+		MaxRetries:   5,
+		RetryBackoff: config.Duration{Duration: time.Millisecond},
+	}
+
+	err := withRetry(cluster, func() error {
+		calls++
+		if calls < 3 {
+			return sarama.ErrOutOfBrokers
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+	if calls != 3 {
+		t.Fatalf("calls = %d, want 3", calls)
+	}
+}
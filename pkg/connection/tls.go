@@ -0,0 +1,88 @@
+package connection
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/birdayz/kaf/pkg/config"
+)
+
+// buildTLSConfig builds a *tls.Config for t, which may be nil (e.g. a plain
+// SASL_SSL cluster with no TLS block of its own). It is shared by both the
+// SASL_SSL and standalone-TLS paths in toSaramaConfig so their behaviour
+// can't drift apart.
+func buildTLSConfig(t *config.TLS) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+
+	if t == nil {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("unable to load system CA pool: %v", err)
+		}
+		tlsConfig.RootCAs = pool
+		return tlsConfig, nil
+	}
+
+	tlsConfig.InsecureSkipVerify = t.Insecure
+	tlsConfig.ServerName = t.ServerName
+
+	if t.Cafile != "" {
+		caCert, err := ioutil.ReadFile(t.Cafile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read Cafile :%v", err)
+		}
+		caCertPool := x509.NewCertPool()
+		caCertPool.AppendCertsFromPEM(caCert)
+		tlsConfig.RootCAs = caCertPool
+	} else {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("unable to load system CA pool: %v", err)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	certs, err := clientCertificates(t)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) > 0 {
+		tlsConfig.Certificates = certs
+		tlsConfig.BuildNameToCertificate()
+	}
+
+	return tlsConfig, nil
+}
+
+// clientCertificates loads every client certificate/key pair configured for
+// mTLS: the legacy singular Clientfile/Clientkeyfile plus any entries under
+// Certificates.
+func clientCertificates(t *config.TLS) ([]tls.Certificate, error) {
+	var pairs []config.ClientCertificate
+	if t.Clientfile != "" && t.Clientkeyfile != "" {
+		pairs = append(pairs, config.ClientCertificate{Certfile: t.Clientfile, Keyfile: t.Clientkeyfile})
+	}
+	pairs = append(pairs, t.Certificates...)
+
+	certs := make([]tls.Certificate, 0, len(pairs))
+	for _, pair := range pairs {
+		certPEM, err := ioutil.ReadFile(pair.Certfile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read Clientfile :%v", err)
+		}
+		keyPEM, err := ioutil.ReadFile(pair.Keyfile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read Clientkeyfile :%v", err)
+		}
+
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to creatre KeyPair: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	return certs, nil
+}
@@ -0,0 +1,115 @@
+package connection
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/birdayz/kaf/pkg/config"
+)
+
+func TestBuildTLSConfig_NilFallsBackToSystemCAPool(t *testing.T) {
+	tlsConfig, err := buildTLSConfig(nil)
+	if err != nil {
+		t.Fatalf("buildTLSConfig() error = %v", err)
+	}
+	if tlsConfig.RootCAs == nil {
+		t.Fatalf("expected RootCAs to fall back to the system pool")
+	}
+}
+
+func TestBuildTLSConfig_NoCafileFallsBackToSystemCAPool(t *testing.T) {
+	tlsConfig, err := buildTLSConfig(&config.TLS{})
+	if err != nil {
+		t.Fatalf("buildTLSConfig() error = %v", err)
+	}
+	if tlsConfig.RootCAs == nil {
+		t.Fatalf("expected RootCAs to fall back to the system pool")
+	}
+}
+
+func TestBuildTLSConfig_ServerNameOverride(t *testing.T) {
+	tlsConfig, err := buildTLSConfig(&config.TLS{ServerName: "broker.internal"})
+	if err != nil {
+		t.Fatalf("buildTLSConfig() error = %v", err)
+	}
+	if tlsConfig.ServerName != "broker.internal" {
+		t.Fatalf("ServerName = %q, want %q", tlsConfig.ServerName, "broker.internal")
+	}
+}
+
+func TestBuildTLSConfig_MultipleClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	cert1, key1 := generateSelfSignedCertPEM(t)
+	cert2, key2 := generateSelfSignedCertPEM(t)
+
+	cert1Path := writeFile(t, dir, "cert1.pem", cert1)
+	key1Path := writeFile(t, dir, "key1.pem", key1)
+	cert2Path := writeFile(t, dir, "cert2.pem", cert2)
+	key2Path := writeFile(t, dir, "key2.pem", key2)
+
+	tlsConfig, err := buildTLSConfig(&config.TLS{
+		Clientfile:    cert1Path,
+		Clientkeyfile: key1Path,
+		Certificates: []config.ClientCertificate{
+			{Certfile: cert2Path, Keyfile: key2Path},
+		},
+	})
+	if err != nil {
+		t.Fatalf("buildTLSConfig() error = %v", err)
+	}
+	if len(tlsConfig.Certificates) != 2 {
+		t.Fatalf("len(Certificates) = %d, want 2", len(tlsConfig.Certificates))
+	}
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return path
+}
+
+// generateSelfSignedCertPEM returns a throwaway self-signed cert/key pair
+// PEM-encoded, for exercising client certificate loading without checked-in
+// fixtures.
+func generateSelfSignedCertPEM(t *testing.T) (certPEM, keyPEM []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() error = %v", err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "kaf-test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate() error = %v", err)
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("x509.MarshalECPrivateKey() error = %v", err)
+	}
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return certPEM, keyPEM
+}